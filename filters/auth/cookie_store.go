@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// maxCookieChunkBytes keeps every individual chunk well under the ~4KB
+// per-cookie limit browsers enforce, leaving room for the cookie's name,
+// attributes and the overhead of other cookies on the same domain.
+const maxCookieChunkBytes = 4000
+
+// OAuthGrantCookieChunkName returns the name of the i-th cookie used to
+// carry a chunk of the sealed session, starting at 0. A session that
+// fits in a single cookie still only ever uses chunk 0.
+func OAuthGrantCookieChunkName(i int) string {
+	return fmt.Sprintf("%s_%d", OAuthGrantCookieName, i)
+}
+
+// CookieSessionStore is the original SessionStore implementation: it
+// seals the whole token into the session cookie itself, so it needs no
+// external storage. Since providers can issue tokens (e.g. OIDC id_tokens
+// with group claims) that don't fit in a single ~4KB cookie, the sealed
+// value is split across as many numbered cookies as it takes. The
+// session id passed to Save is not used, since there is nothing to key
+// by - the cookie chunks are the session.
+type CookieSessionStore struct {
+	encrypter encrypter
+}
+
+// NewCookieSessionStore creates a CookieSessionStore that seals cookie
+// values with encrypter.
+func NewCookieSessionStore(encrypter encrypter) *CookieSessionStore {
+	return &CookieSessionStore{encrypter: encrypter}
+}
+
+func (s *CookieSessionStore) Save(ctx filters.FilterContext, _ string, tok *sessionToken) ([]*http.Cookie, error) {
+	plain, err := json.Marshal(tok)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := s.encrypter.Encrypt(plain)
+	if err != nil {
+		return nil, err
+	}
+
+	cookies := chunkSessionCookies(base64.RawURLEncoding.EncodeToString(sealed))
+	cookies = append(cookies, staleChunkCookies(ctx.Request(), len(cookies))...)
+
+	return cookies, nil
+}
+
+// staleChunkCookies returns expiry cookies for any chunk index beyond
+// from that req still carries, so that a session shrinking below its
+// previous chunk count (e.g. a refresh that drops OIDC claims) doesn't
+// leave stale chunks in the browser for Load to wrongly concatenate
+// onto the new, smaller session.
+func staleChunkCookies(req *http.Request, from int) []*http.Cookie {
+	var cookies []*http.Cookie
+
+	for i := from; ; i++ {
+		name := OAuthGrantCookieChunkName(i)
+		if _, err := req.Cookie(name); err != nil {
+			break
+		}
+
+		cookies = append(cookies, expiredSessionCookie(name))
+	}
+
+	return cookies
+}
+
+func chunkSessionCookies(value string) []*http.Cookie {
+	var cookies []*http.Cookie
+
+	for i := 0; ; i++ {
+		end := maxCookieChunkBytes
+		if end > len(value) {
+			end = len(value)
+		}
+
+		cookies = append(cookies, sessionCookie(OAuthGrantCookieChunkName(i), value[:end]))
+		value = value[end:]
+
+		if value == "" {
+			break
+		}
+	}
+
+	return cookies
+}
+
+func (s *CookieSessionStore) Load(_ filters.FilterContext, req *http.Request) (*sessionToken, error) {
+	var value strings.Builder
+
+	for i := 0; ; i++ {
+		c, err := req.Cookie(OAuthGrantCookieChunkName(i))
+		if err != nil {
+			if i == 0 {
+				return nil, errMissingSessionCookie
+			}
+
+			break
+		}
+
+		value.WriteString(c.Value)
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(value.String())
+	if err != nil {
+		return nil, errMissingSessionCookie
+	}
+
+	plain, err := s.encrypter.Decrypt(raw)
+	if err != nil {
+		return nil, errMissingSessionCookie
+	}
+
+	var tok sessionToken
+	if err := json.Unmarshal(plain, &tok); err != nil {
+		return nil, errMissingSessionCookie
+	}
+
+	if time.Now().After(tok.Expiry) {
+		return nil, errMissingSessionCookie
+	}
+
+	return &tok, nil
+}
+
+func (s *CookieSessionStore) Clear(_ filters.FilterContext, req *http.Request) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+
+	for i := 0; ; i++ {
+		name := OAuthGrantCookieChunkName(i)
+		if _, err := req.Cookie(name); err != nil {
+			break
+		}
+
+		cookies = append(cookies, expiredSessionCookie(name))
+	}
+
+	if len(cookies) == 0 {
+		cookies = append(cookies, expiredSessionCookie(OAuthGrantCookieChunkName(0)))
+	}
+
+	return cookies, nil
+}
+
+func sessionCookie(name, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(grantCookieMaxAge / time.Second),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func expiredSessionCookie(name string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,330 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/secrets"
+)
+
+const (
+	// OAuthGrantName is the name of the filter that initiates the OAuth2
+	// authorization code grant flow for requests that lack a valid session
+	// cookie.
+	OAuthGrantName = "oauthGrant"
+
+	// OAuthGrantCallbackName is the name of the filter that handles the
+	// redirect back from the authorization server, exchanges the code for
+	// a token and establishes the session cookie.
+	OAuthGrantCallbackName = "oauthGrantCallback"
+
+	// OAuthGrantCookieName is the base name of the cookies that store the
+	// grant session. The session itself is carried in cookies named by
+	// OAuthGrantCookieChunkName ("<name>_0", "<name>_1", ...).
+	OAuthGrantCookieName = "skipper-oauth-grant"
+
+	// oauthGrantCSRFCookieName is the short-lived cookie that binds the
+	// state parameter sent to the authorization server to the browser
+	// that initiated the flow, so a stolen authorization code cannot be
+	// redeemed from a different client.
+	oauthGrantCSRFCookieName = OAuthGrantCookieName + "_csrf"
+
+	defaultCallbackPath = "/.well-known/oauth2-callback"
+
+	grantCSRFCookieMaxAge = 10 * time.Minute
+	grantCookieMaxAge     = time.Hour
+
+	secretsRefreshInterval  = time.Minute
+	defaultTokenRefreshSkew = 2 * time.Minute
+
+	// grantRefreshCookieKey is the StateBag key grantFilter.Request uses
+	// to pass a freshly refreshed session cookie to the Response phase,
+	// since a pass-through request doesn't otherwise touch the response.
+	grantRefreshCookieKey = "auth.grantRefreshCookie"
+)
+
+var (
+	errMissingSecretsRegistry = errors.New("auth: missing Secrets registry")
+	errMissingSecretFile      = errors.New("auth: missing SecretFile")
+	errMissingProviderURLs    = errors.New("auth: missing AuthURL or TokenURL")
+	errMissingCSRFCookie      = errors.New("auth: missing CSRF cookie")
+	errInvalidCSRFState       = errors.New("auth: CSRF state mismatch")
+	errTokenExchangeFailed    = errors.New("auth: token exchange failed")
+	errInvalidAccessToken     = errors.New("auth: access token rejected by tokeninfo")
+)
+
+// OAuthConfig configures the OAuth2 authorization code grant filters,
+// NewGrant and NewGrantCallback. It is typically created once per skipper
+// process and shared between the filter specs it creates.
+type OAuthConfig struct {
+	// ClientID is the OAuth2 client id registered with the provider.
+	ClientID string
+
+	// ClientSecret is the OAuth2 client secret registered with the
+	// provider.
+	ClientSecret string
+
+	// AuthURL is the authorization endpoint of the OAuth2 provider.
+	AuthURL string
+
+	// TokenURL is the token endpoint of the OAuth2 provider.
+	TokenURL string
+
+	// TokeninfoURL, when set, is used to validate the access token
+	// stored in the session before letting a request pass.
+	TokeninfoURL string
+
+	// Issuer, when set, switches the grant flow into OpenID Connect
+	// mode: the "openid" scope is requested, the returned id_token is
+	// validated against JWKSURL and its claims are persisted alongside
+	// the access token.
+	Issuer string
+
+	// JWKSURL is the JSON Web Key Set endpoint of the OIDC provider,
+	// used to verify id_token signatures. Required when Issuer is set.
+	JWKSURL string
+
+	// Scopes are the additional OAuth2 scopes requested besides
+	// "openid" when Issuer is set.
+	Scopes []string
+
+	// TokenRefreshSkew is how far ahead of the stored token's expiry
+	// the grant filter proactively refreshes it using the refresh
+	// token. Defaults to 2 minutes.
+	TokenRefreshSkew time.Duration
+
+	// AllowedRedirectDomains restricts which hosts the callback is
+	// allowed to send the client back to after a successful grant,
+	// matched by exact host or wildcard subdomain (e.g. "*.example.com").
+	// When empty, only the proxy's own host is allowed.
+	AllowedRedirectDomains []string
+
+	// CallbackPath is the path of the redirect_uri registered with the
+	// provider. Defaults to defaultCallbackPath.
+	CallbackPath string
+
+	// Secrets is the registry used to fetch the encryption key used to
+	// seal the session cookie.
+	Secrets *secrets.Registry
+
+	// SecretFile points to the file containing the encryption key for
+	// the session cookie, refreshed periodically via Secrets.
+	SecretFile string
+
+	// Store is the SessionStore backend used to persist the grant
+	// session. Defaults to a CookieSessionStore sealed with the key
+	// from SecretFile when left nil.
+	Store SessionStore
+
+	encrypter encrypter
+	jwks      *jwksCache
+}
+
+// encrypter abstracts the symmetric encryption used to seal values placed
+// in browser cookies.
+type encrypter interface {
+	Encrypt([]byte) ([]byte, error)
+	Decrypt([]byte) ([]byte, error)
+}
+
+func (c *OAuthConfig) init() error {
+	if c.Secrets == nil {
+		return errMissingSecretsRegistry
+	}
+
+	if c.SecretFile == "" {
+		return errMissingSecretFile
+	}
+
+	if c.AuthURL == "" || c.TokenURL == "" {
+		return errMissingProviderURLs
+	}
+
+	if c.CallbackPath == "" {
+		c.CallbackPath = defaultCallbackPath
+	}
+
+	if c.encrypter == nil {
+		e, err := c.Secrets.GetEncrypter(secretsRefreshInterval, c.SecretFile)
+		if err != nil {
+			return err
+		}
+
+		c.encrypter = e
+	}
+
+	if c.Store == nil {
+		c.Store = NewCookieSessionStore(c.encrypter)
+	}
+
+	if c.TokenRefreshSkew == 0 {
+		c.TokenRefreshSkew = defaultTokenRefreshSkew
+	}
+
+	if c.Issuer != "" && c.jwks == nil {
+		c.jwks = newJWKSCache(c.JWKSURL)
+		c.jwks.start()
+	}
+
+	return nil
+}
+
+// NewGrant creates a filter spec for the grant filter. The filter, when
+// the incoming request has no valid session cookie, redirects the client
+// to the provider's authorization endpoint, binding a freshly generated
+// CSRF nonce both to a short-lived cookie and to the state parameter.
+// Websocket upgrade requests without a valid session are not redirected;
+// they are answered with 401 and a WWW-Authenticate header.
+func (c *OAuthConfig) NewGrant() (filters.Spec, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+
+	return &grantSpec{config: c}, nil
+}
+
+// NewGrantCallback creates a filter spec for the callback filter that
+// handles the redirect back from the provider, verifies the CSRF state,
+// exchanges the authorization code for a token and sets the session
+// cookie.
+func (c *OAuthConfig) NewGrantCallback() (filters.Spec, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+
+	return &grantCallbackSpec{config: c}, nil
+}
+
+type grantSpec struct {
+	config *OAuthConfig
+}
+
+func (s *grantSpec) Name() string { return OAuthGrantName }
+
+func (s *grantSpec) CreateFilter([]interface{}) (filters.Filter, error) {
+	return &grantFilter{config: s.config}, nil
+}
+
+type grantFilter struct {
+	config *OAuthConfig
+}
+
+func (f *grantFilter) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+
+	if tok, err := f.config.Store.Load(ctx, req); err == nil && f.sessionValid(tok) {
+		f.passThrough(ctx, tok)
+		return
+	}
+
+	if isWebsocketUpgrade(req) {
+		// A websocket handshake can't follow a redirect, so there is
+		// no point sending one: reject outright and let the client
+		// (re-)authenticate out of band before retrying the upgrade.
+		ctx.Serve(&http.Response{
+			Header:     http.Header{"WWW-Authenticate": {"Bearer"}},
+			StatusCode: http.StatusUnauthorized,
+		})
+		return
+	}
+
+	nonce, err := newCSRFNonce()
+	if err != nil {
+		ctx.Serve(&http.Response{StatusCode: http.StatusInternalServerError})
+		return
+	}
+
+	state, err := createState(originalURL(req), nonce)
+	if err != nil {
+		ctx.Serve(&http.Response{StatusCode: http.StatusInternalServerError})
+		return
+	}
+
+	rsp := &http.Response{
+		Header: http.Header{},
+	}
+
+	rsp.Header.Set("Location", buildAuthURL(f.config, req, state, nonce))
+	http.SetCookie(&headerWriter{rsp.Header}, csrfCookie(nonce))
+	rsp.StatusCode = http.StatusTemporaryRedirect
+
+	ctx.Serve(rsp)
+}
+
+// sessionValid reports whether tok's access token is still accepted by
+// the provider's tokeninfo endpoint. Sessions that fail validation are
+// treated the same as a missing one, sending the client back through the
+// grant flow instead of passing the request through. When TokeninfoURL
+// is not configured, the access token is trusted as-is.
+func (f *grantFilter) sessionValid(tok *sessionToken) bool {
+	if f.config.TokeninfoURL == "" {
+		return true
+	}
+
+	return validateAccessToken(f.config, tok.AccessToken) == nil
+}
+
+// passThrough lets an already-authenticated request proceed to the
+// backend. It exposes any persisted OIDC claims to downstream filters via
+// oidcClaimsHeader, and transparently refreshes the session when it is
+// within TokenRefreshSkew of expiring.
+func (f *grantFilter) passThrough(ctx filters.FilterContext, tok *sessionToken) {
+	req := ctx.Request()
+
+	if len(tok.IDClaims) > 0 {
+		if b, err := json.Marshal(tok.IDClaims); err == nil {
+			req.Header.Set(oidcClaimsHeader, string(b))
+		}
+	}
+
+	if tok.RefreshToken == "" || time.Until(tok.Expiry) > f.config.TokenRefreshSkew {
+		return
+	}
+
+	refreshed, err := refreshAccessToken(f.config, tok.RefreshToken)
+	if err != nil {
+		return
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return
+	}
+
+	cookies, err := f.config.Store.Save(ctx, id, refreshed)
+	if err != nil {
+		return
+	}
+
+	ctx.StateBag()[grantRefreshCookieKey] = cookies
+}
+
+func (f *grantFilter) Response(ctx filters.FilterContext) {
+	cookies, ok := ctx.StateBag()[grantRefreshCookieKey].([]*http.Cookie)
+	if !ok {
+		return
+	}
+
+	for _, cookie := range cookies {
+		http.SetCookie(&headerWriter{ctx.Response().Header}, cookie)
+	}
+}
+
+func isWebsocketUpgrade(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Upgrade"), "websocket")
+}
+
+// headerWriter adapts an http.Header so that http.SetCookie, which expects
+// an http.ResponseWriter, can append a Set-Cookie header to a synthetic
+// http.Response built inside a filter.
+type headerWriter struct {
+	h http.Header
+}
+
+func (w *headerWriter) Header() http.Header        { return w.h }
+func (w *headerWriter) Write([]byte) (int, error)  { return 0, nil }
+func (w *headerWriter) WriteHeader(statusCode int) {}
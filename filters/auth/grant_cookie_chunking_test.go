@@ -0,0 +1,106 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zalando/skipper/filters/auth"
+)
+
+// permissiveCookieJar is a minimal http.CookieJar that ignores domain and
+// path scoping, good enough to let a single *http.Client carry every
+// cookie chunk across the redirects of the grant flow in tests, without
+// net/http/cookiejar's stricter (and here irrelevant) same-site/Secure
+// handling getting in the way of a plain-http httptest server.
+type permissiveCookieJar struct {
+	mu      sync.Mutex
+	cookies map[string]*http.Cookie
+}
+
+func newPermissiveCookieJar() *permissiveCookieJar {
+	return &permissiveCookieJar{cookies: map[string]*http.Cookie{}}
+}
+
+func (j *permissiveCookieJar) SetCookies(_ *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, c := range cookies {
+		if c.MaxAge < 0 {
+			delete(j.cookies, c.Name)
+			continue
+		}
+
+		cp := *c
+		j.cookies[c.Name] = &cp
+	}
+}
+
+func (j *permissiveCookieJar) Cookies(*url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	cookies := make([]*http.Cookie, 0, len(j.cookies))
+	for _, c := range j.cookies {
+		cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+	}
+
+	return cookies
+}
+
+func TestGrantFlowLargeSessionCookieChunking(t *testing.T) {
+	t.Log("use an access token large enough that the sealed session exceeds 8KB")
+	largeToken := strings.Repeat("a", 8192)
+
+	provider := newTestAuthServer(largeToken, testAccessCode)
+	defer provider.Close()
+
+	tokeninfo := newTestTokeninfo(largeToken)
+	defer tokeninfo.Close()
+
+	proxy, err := newAuthProxy(tokeninfo.URL, provider.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Jar: newPermissiveCookieJar()}
+
+	t.Log("run the full grant flow, following redirects automatically via the cookie jar")
+	rsp, err := client.Get(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	checkStatus(t, rsp, http.StatusNoContent)
+
+	jar := client.Jar.(*permissiveCookieJar)
+	cookies := jar.Cookies(nil)
+
+	names := make(map[string]bool, len(cookies))
+	for _, c := range cookies {
+		names[c.Name] = true
+	}
+
+	var chunkCount int
+	for names[auth.OAuthGrantCookieChunkName(chunkCount)] {
+		chunkCount++
+	}
+
+	t.Logf("session was split into %d cookie chunks", chunkCount)
+	if chunkCount < 3 {
+		t.Fatalf("expected the >8KB session to be split into at least 3 cookies, got %d", chunkCount)
+	}
+
+	t.Log("a second request presenting all chunks via the jar should stay authenticated")
+	rsp, err = client.Get(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	checkStatus(t, rsp, http.StatusNoContent)
+}
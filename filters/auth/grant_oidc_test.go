@@ -0,0 +1,380 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/auth"
+	"github.com/zalando/skipper/proxy/proxytest"
+	"github.com/zalando/skipper/secrets"
+)
+
+const (
+	testOIDCIssuer   = "https://issuer.example.test"
+	testOIDCClientID = "test-oidc-client"
+	testOIDCKeyID    = "test-oidc-key"
+
+	// testOIDCNonce must match the fixed nonce doCallbackRequest embeds in
+	// the CSRF cookie and state parameter, since exchangeCode checks the
+	// id_token's nonce claim against the nonce carried in the state.
+	testOIDCNonce = "test-nonce"
+
+	// oidcClaimsHeader mirrors filters/auth's unexported header name of
+	// the same value, since the grant filter exposes the persisted claims
+	// to the backend only via this header, which is all a test from
+	// outside the package can observe.
+	oidcClaimsHeader = "X-Grant-Oidc-Claims"
+)
+
+// testJWK and testJWKSDocument mirror the wire format of the package's
+// unexported jwk/jwksDocument types, so tests can serve a JWKS document
+// without depending on internals.
+type testJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type testJWKSDocument struct {
+	Keys []testJWK `json:"keys"`
+}
+
+func generateTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v.", err)
+	}
+
+	return key
+}
+
+func rsaJWK(key *rsa.PublicKey, kid string) testJWK {
+	return testJWK{
+		Kty: "RSA",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func newTestJWKSServer(keys ...testJWK) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(testJWKSDocument{Keys: keys})
+	}))
+}
+
+// signIDToken builds a JWT with the given header alg/kid and claims,
+// signed with key using RS256, regardless of what alg claims to be, so
+// tests can exercise the alg-confusion rejection path too.
+func signIDToken(t *testing.T, key *rsa.PrivateKey, kid, alg string, claims map[string]interface{}) string {
+	t.Helper()
+
+	headerJSON, err := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+	if err != nil {
+		t.Fatalf("Failed to marshal id_token header: %v.", err)
+	}
+
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Failed to marshal id_token claims: %v.", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign id_token: %v.", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func baseIDTokenClaims(nonce string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":   testOIDCIssuer,
+		"aud":   testOIDCClientID,
+		"exp":   float64(now.Add(time.Hour).Unix()),
+		"iat":   float64(now.Unix()),
+		"nonce": nonce,
+	}
+}
+
+func withClaim(claims map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(claims))
+	for k, v := range claims {
+		c[k] = v
+	}
+	c[key] = value
+	return c
+}
+
+// newOIDCTestAuthServer is newTestAuthServer's /auth handler paired with
+// a /token handler that also returns idToken, the way an OIDC provider's
+// token endpoint returns an id_token alongside the access token.
+func newOIDCTestAuthServer(accessToken, accessCode, idToken string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := func(w http.ResponseWriter, r *http.Request) {
+			rq := r.URL.Query()
+			redirect := rq.Get("redirect_uri")
+			rd, err := url.Parse(redirect)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			q := rd.Query()
+			q.Set("code", accessCode)
+			q.Set("state", r.URL.Query().Get("state"))
+			rd.RawQuery = q.Encode()
+
+			http.Redirect(w, r, rd.String(), http.StatusTemporaryRedirect)
+		}
+
+		token := func(w http.ResponseWriter, r *http.Request) {
+			if r.FormValue("code") != accessCode {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			type tokenJSON struct {
+				AccessToken string `json:"access_token"`
+				ExpiresIn   int    `json:"expires_in"`
+				IDToken     string `json:"id_token,omitempty"`
+			}
+
+			b, err := json.Marshal(tokenJSON{
+				AccessToken: accessToken,
+				ExpiresIn:   int(time.Hour / time.Second),
+				IDToken:     idToken,
+			})
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(b)
+		}
+
+		switch r.URL.Path {
+		case "/auth":
+			auth(w, r)
+		case "/token":
+			token(w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func newHeaderEchoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(oidcClaimsHeader, r.Header.Get(oidcClaimsHeader))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+// newOIDCAuthProxy wires an OAuthConfig in OIDC mode, validating id_tokens
+// against jwksURL. When backendURL is empty the route shunts to a 204,
+// like newAuthProxy; otherwise it proxies to backendURL, so a test can
+// inspect what the backend received.
+func newOIDCAuthProxy(tokeninfoURL, providerURL, jwksURL, backendURL string) (*proxytest.TestProxy, error) {
+	config := &auth.OAuthConfig{
+		Secrets:      secrets.NewRegistry(),
+		SecretFile:   testSecretFile,
+		TokeninfoURL: tokeninfoURL,
+		AuthURL:      providerURL + "/auth",
+		TokenURL:     providerURL + "/token",
+		ClientID:     testOIDCClientID,
+		Issuer:       testOIDCIssuer,
+		JWKSURL:      jwksURL,
+	}
+
+	if backendURL == "" {
+		return newGrantProxy(config, shuntRoute())
+	}
+
+	return newGrantProxy(config, &eskip.Route{
+		Filters: []*eskip.Filter{{Name: auth.OAuthGrantName}},
+		Backend: backendURL,
+	})
+}
+
+func TestGrantCallbackOIDCAcceptsValidIDToken(t *testing.T) {
+	key := generateTestRSAKey(t)
+
+	jwks := newTestJWKSServer(rsaJWK(&key.PublicKey, testOIDCKeyID))
+	defer jwks.Close()
+
+	claims := withClaim(baseIDTokenClaims(testOIDCNonce), "email", "user@example.test")
+	idToken := signIDToken(t, key, testOIDCKeyID, "RS256", claims)
+
+	provider := newOIDCTestAuthServer(testToken, testAccessCode, idToken)
+	defer provider.Close()
+
+	tokeninfo := newTestTokeninfo(testToken)
+	defer tokeninfo.Close()
+
+	backend := newHeaderEchoServer()
+	defer backend.Close()
+
+	proxy, err := newOIDCAuthProxy(tokeninfo.URL, provider.URL, jwks.URL, backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("complete the callback with a validly signed id_token")
+	rsp := doCallbackRequest(t, proxy.URL, proxy.URL+"/after-login", nil)
+	defer rsp.Body.Close()
+	checkRedirect(t, rsp, proxy.URL+"/after-login")
+
+	c, ok := findAuthCookie(rsp)
+	if !ok {
+		t.Fatalf("Cookie not found.")
+	}
+
+	req, err := http.NewRequest("GET", proxy.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v.", err)
+	}
+	req.Header.Set("Cookie", fmt.Sprintf("%s=%s", c.Name, c.Value))
+
+	client := newHTTPClient()
+	rsp2, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make request to proxy: %v.", err)
+	}
+	defer rsp2.Body.Close()
+
+	checkStatus(t, rsp2, http.StatusNoContent)
+
+	t.Log("expect the id_token claims to have reached the backend")
+	if got := rsp2.Header.Get(oidcClaimsHeader); !strings.Contains(got, `"email":"user@example.test"`) {
+		t.Fatalf("Expected oidc claims header to carry the email claim, got: %q.", got)
+	}
+}
+
+func TestGrantCallbackOIDCRejectsInvalidIDToken(t *testing.T) {
+	key := generateTestRSAKey(t)
+	otherKey := generateTestRSAKey(t)
+
+	jwks := newTestJWKSServer(
+		rsaJWK(&key.PublicKey, testOIDCKeyID),
+		testJWK{Kty: "EC", Kid: "ec-key"},
+	)
+	defer jwks.Close()
+
+	cases := []struct {
+		name   string
+		kid    string
+		alg    string
+		key    *rsa.PrivateKey
+		claims map[string]interface{}
+	}{
+		{
+			name:   "wrong issuer",
+			kid:    testOIDCKeyID,
+			alg:    "RS256",
+			key:    key,
+			claims: withClaim(baseIDTokenClaims(testOIDCNonce), "iss", "https://not-the-issuer.example.test"),
+		},
+		{
+			name:   "wrong audience",
+			kid:    testOIDCKeyID,
+			alg:    "RS256",
+			key:    key,
+			claims: withClaim(baseIDTokenClaims(testOIDCNonce), "aud", "someone-else"),
+		},
+		{
+			name:   "expired",
+			kid:    testOIDCKeyID,
+			alg:    "RS256",
+			key:    key,
+			claims: withClaim(baseIDTokenClaims(testOIDCNonce), "exp", float64(time.Now().Add(-time.Hour).Unix())),
+		},
+		{
+			name:   "issued too far in the future",
+			kid:    testOIDCKeyID,
+			alg:    "RS256",
+			key:    key,
+			claims: withClaim(baseIDTokenClaims(testOIDCNonce), "iat", float64(time.Now().Add(time.Hour).Unix())),
+		},
+		{
+			name:   "nonce mismatch",
+			kid:    testOIDCKeyID,
+			alg:    "RS256",
+			key:    key,
+			claims: withClaim(baseIDTokenClaims(testOIDCNonce), "nonce", "wrong-nonce"),
+		},
+		{
+			name:   "unknown kid",
+			kid:    "no-such-key",
+			alg:    "RS256",
+			key:    key,
+			claims: baseIDTokenClaims(testOIDCNonce),
+		},
+		{
+			name:   "kid resolves to a non-RSA JWKS entry",
+			kid:    "ec-key",
+			alg:    "RS256",
+			key:    key,
+			claims: baseIDTokenClaims(testOIDCNonce),
+		},
+		{
+			name:   "non-RS256 alg",
+			kid:    testOIDCKeyID,
+			alg:    "none",
+			key:    key,
+			claims: baseIDTokenClaims(testOIDCNonce),
+		},
+		{
+			name:   "signed with a key absent from the JWKS",
+			kid:    testOIDCKeyID,
+			alg:    "RS256",
+			key:    otherKey,
+			claims: baseIDTokenClaims(testOIDCNonce),
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			idToken := signIDToken(t, c.key, c.kid, c.alg, c.claims)
+
+			provider := newOIDCTestAuthServer(testToken, testAccessCode, idToken)
+			defer provider.Close()
+
+			tokeninfo := newTestTokeninfo(testToken)
+			defer tokeninfo.Close()
+
+			proxy, err := newOIDCAuthProxy(tokeninfo.URL, provider.URL, jwks.URL, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rsp := doCallbackRequest(t, proxy.URL, proxy.URL+"/after-login", nil)
+			defer rsp.Body.Close()
+
+			checkStatus(t, rsp, http.StatusUnauthorized)
+		})
+	}
+}
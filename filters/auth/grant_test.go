@@ -104,15 +104,11 @@ func newTestAuthServer(testToken, testAccessCode string) *httptest.Server {
 	}))
 }
 
-func newAuthProxy(tokeninfoURL, providerURL string) (*proxytest.TestProxy, error) {
-	config := &auth.OAuthConfig{
-		Secrets:      secrets.NewRegistry(),
-		SecretFile:   testSecretFile,
-		TokeninfoURL: tokeninfoURL,
-		AuthURL:      providerURL + "/auth",
-		TokenURL:     providerURL + "/token",
-	}
-
+// newGrantProxy wires config's grant filters into a registry and
+// preprocessor and stands up a test proxy serving route, factoring out
+// the registry/preprocessor boilerplate every *_test.go file that needs a
+// grant proxy would otherwise repeat verbatim.
+func newGrantProxy(config *auth.OAuthConfig, route *eskip.Route) (*proxytest.TestProxy, error) {
 	grantSpec, err := config.NewGrant()
 	if err != nil {
 		return nil, err
@@ -136,13 +132,44 @@ func newAuthProxy(tokeninfoURL, providerURL string) (*proxytest.TestProxy, error
 		PreProcessors: []routing.PreProcessor{grantPrep},
 	}
 
-	return proxytest.WithRoutingOptions(fr, ro, &eskip.Route{
+	return proxytest.WithRoutingOptions(fr, ro, route), nil
+}
+
+// shuntRoute is the oauthGrant-then-204 route every fixture that doesn't
+// care about what's behind the filter reuses.
+func shuntRoute() *eskip.Route {
+	return &eskip.Route{
 		Filters: []*eskip.Filter{
 			{Name: auth.OAuthGrantName},
 			{Name: "status", Args: []interface{}{http.StatusNoContent}},
 		},
 		BackendType: eskip.ShuntBackend,
-	}), nil
+	}
+}
+
+func newAuthProxy(tokeninfoURL, providerURL string) (*proxytest.TestProxy, error) {
+	config := &auth.OAuthConfig{
+		Secrets:      secrets.NewRegistry(),
+		SecretFile:   testSecretFile,
+		TokeninfoURL: tokeninfoURL,
+		AuthURL:      providerURL + "/auth",
+		TokenURL:     providerURL + "/token",
+	}
+
+	return newGrantProxy(config, shuntRoute())
+}
+
+func newAuthProxyWithCallbackPath(tokeninfoURL, providerURL, callbackPath string) (*proxytest.TestProxy, error) {
+	config := &auth.OAuthConfig{
+		Secrets:      secrets.NewRegistry(),
+		SecretFile:   testSecretFile,
+		TokeninfoURL: tokeninfoURL,
+		AuthURL:      providerURL + "/auth",
+		TokenURL:     providerURL + "/token",
+		CallbackPath: callbackPath,
+	}
+
+	return newGrantProxy(config, shuntRoute())
 }
 
 func newHTTPClient() *http.Client {
@@ -177,7 +204,7 @@ func checkRedirect(t *testing.T, rsp *http.Response, expectedURL string) {
 
 func findAuthCookie(rsp *http.Response) (*http.Cookie, bool) {
 	for _, c := range rsp.Cookies() {
-		if c.Name == auth.OAuthGrantCookieName {
+		if c.Name == auth.OAuthGrantCookieChunkName(0) {
 			return c, true
 		}
 	}
@@ -196,6 +223,66 @@ func checkCookie(t *testing.T, rsp *http.Response) {
 	}
 }
 
+// findCSRFCookie returns the short-lived CSRF cookie set on the initial
+// redirect to the provider, so tests without a cookie jar can re-attach it
+// by hand to the callback request, the same way the session cookie set by
+// the callback is re-attached to the final authenticated request.
+func findCSRFCookie(rsp *http.Response) (*http.Cookie, bool) {
+	for _, c := range rsp.Cookies() {
+		if c.Name == auth.OAuthGrantCookieName+"_csrf" {
+			return c, true
+		}
+	}
+
+	return nil, false
+}
+
+// completeGrantFlow drives an unauthenticated request to proxyURL through
+// the full redirect dance against providerURL — authorization, then the
+// callback with the CSRF cookie set on the first redirect carried along,
+// since client has no cookie jar to do it automatically — and returns the
+// final response redirecting back to proxyURL with the session cookie
+// set. This is the common prefix every test needing an authenticated
+// session starts with.
+func completeGrantFlow(t *testing.T, client *http.Client, proxyURL, providerURL string) *http.Response {
+	t.Helper()
+
+	rsp, err := client.Get(proxyURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	checkRedirect(t, rsp, providerURL+"/auth")
+
+	csrfCookie, ok := findCSRFCookie(rsp)
+	if !ok {
+		t.Fatalf("CSRF cookie not found.")
+	}
+
+	rsp, err = client.Get(rsp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Failed to make request to provider: %v.", err)
+	}
+	rsp.Body.Close()
+	checkRedirect(t, rsp, proxyURL+"/.well-known/oauth2-callback")
+
+	callbackReq, err := http.NewRequest("GET", rsp.Header.Get("Location"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v.", err)
+	}
+
+	callbackReq.Header.Set("Cookie", fmt.Sprintf("%s=%s", csrfCookie.Name, csrfCookie.Value))
+	rsp, err = client.Do(callbackReq)
+	if err != nil {
+		t.Fatalf("Failed to make request to proxy: %v.", err)
+	}
+
+	checkRedirect(t, rsp, proxyURL)
+	checkCookie(t, rsp)
+
+	return rsp
+}
+
 func TestGrantFlow(t *testing.T) {
 	t.Log("create a test provider")
 	provider := newTestAuthServer(testToken, testAccessCode)
@@ -214,58 +301,386 @@ func TestGrantFlow(t *testing.T) {
 	t.Log("create a client without redirects, to check it manually")
 	client := newHTTPClient()
 
-	t.Log("make a request to the proxy without a cookie")
+	t.Log("run through the grant flow to obtain a session cookie")
+	rsp := completeGrantFlow(t, client, proxy.URL, provider.URL)
+	defer rsp.Body.Close()
+
+	t.Log("follow the redirect, with the cookie")
+	req, err := http.NewRequest("GET", rsp.Header.Get("Location"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v.", err)
+	}
+
+	c, _ := findAuthCookie(rsp)
+	req.Header.Set("Cookie", fmt.Sprintf("%s=%s", c.Name, c.Value))
+	rsp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make request to proxy: %v.", err)
+	}
+
+	t.Log("check for successful request")
+	checkStatus(t, rsp, http.StatusNoContent)
+}
+
+func TestGrantFlowCustomCallbackPath(t *testing.T) {
+	t.Log("create a test provider")
+	provider := newTestAuthServer(testToken, testAccessCode)
+	defer provider.Close()
+
+	t.Log("create a test tokeninfo")
+	tokeninfo := newTestTokeninfo(testToken)
+	defer tokeninfo.Close()
+
+	t.Log("configure a callback path other than the default")
+	proxy, err := newAuthProxyWithCallbackPath(tokeninfo.URL, provider.URL, "/custom-callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newHTTPClient()
+
 	rsp, err := client.Get(proxy.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer rsp.Body.Close()
+	checkRedirect(t, rsp, provider.URL+"/auth")
+
+	csrfCookie, ok := findCSRFCookie(rsp)
+	if !ok {
+		t.Fatalf("CSRF cookie not found.")
+	}
+
+	rsp, err = client.Get(rsp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Failed to make request to provider: %v.", err)
+	}
+	defer rsp.Body.Close()
+
+	t.Log("expect the redirect_uri sent to the provider to use the configured callback path")
+	checkRedirect(t, rsp, proxy.URL+"/custom-callback")
 
+	callbackReq, err := http.NewRequest("GET", rsp.Header.Get("Location"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v.", err)
+	}
+
+	callbackReq.Header.Set("Cookie", fmt.Sprintf("%s=%s", csrfCookie.Name, csrfCookie.Value))
+	rsp, err = client.Do(callbackReq)
+	if err != nil {
+		t.Fatalf("Failed to make request to proxy: %v.", err)
+	}
 	defer rsp.Body.Close()
 
-	t.Log("get redirected to the auth endpoint")
+	t.Log("get redirected back to the proxy, with the session established through the custom callback route")
+	checkRedirect(t, rsp, proxy.URL)
+	checkCookie(t, rsp)
+}
+
+func TestGrantFlowRevalidatesSessionAgainstTokeninfo(t *testing.T) {
+	t.Log("create a test provider")
+	provider := newTestAuthServer(testToken, testAccessCode)
+	defer provider.Close()
+
+	t.Log("create a tokeninfo that rejects every access token")
+	tokeninfo := newTestTokeninfo("not-" + testToken)
+	defer tokeninfo.Close()
+
+	proxy, err := newAuthProxy(tokeninfo.URL, provider.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newHTTPClient()
+
+	t.Log("run through the grant flow; the callback itself never calls tokeninfo")
+	rsp, err := client.Get(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
 	checkRedirect(t, rsp, provider.URL+"/auth")
 
-	t.Log("follow the redirect")
+	csrfCookie, ok := findCSRFCookie(rsp)
+	if !ok {
+		t.Fatalf("CSRF cookie not found.")
+	}
+
 	rsp, err = client.Get(rsp.Header.Get("Location"))
 	if err != nil {
 		t.Fatalf("Failed to make request to provider: %v.", err)
 	}
+	defer rsp.Body.Close()
+	checkRedirect(t, rsp, proxy.URL+"/.well-known/oauth2-callback")
 
+	callbackReq, err := http.NewRequest("GET", rsp.Header.Get("Location"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v.", err)
+	}
+
+	callbackReq.Header.Set("Cookie", fmt.Sprintf("%s=%s", csrfCookie.Name, csrfCookie.Value))
+	rsp, err = client.Do(callbackReq)
+	if err != nil {
+		t.Fatalf("Failed to make request to proxy: %v.", err)
+	}
 	defer rsp.Body.Close()
+	checkRedirect(t, rsp, proxy.URL)
+	checkCookie(t, rsp)
 
-	t.Log("get redirected back to the proxy callback URL")
-	checkRedirect(t, rsp, proxy.URL+"/.well-known/oauth2-callback")
+	c, _ := findAuthCookie(rsp)
 
-	t.Log("follow the redirect")
-	rsp, err = client.Get(rsp.Header.Get("Location"))
+	t.Log("present the session cookie tokeninfo will reject")
+	req, err := http.NewRequest("GET", rsp.Header.Get("Location"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v.", err)
+	}
+
+	req.Header.Set("Cookie", fmt.Sprintf("%s=%s", c.Name, c.Value))
+	rsp, err = client.Do(req)
 	if err != nil {
 		t.Fatalf("Failed to make request to proxy: %v.", err)
 	}
+	defer rsp.Body.Close()
 
+	t.Log("expect to be sent back through the grant flow instead of passing through")
+	checkRedirect(t, rsp, provider.URL+"/auth")
+}
+
+func TestGrantFlowMissingCSRFCookie(t *testing.T) {
+	t.Log("create a test provider")
+	provider := newTestAuthServer(testToken, testAccessCode)
+	defer provider.Close()
+
+	t.Log("create a test tokeninfo")
+	tokeninfo := newTestTokeninfo(testToken)
+	defer tokeninfo.Close()
+
+	proxy, err := newAuthProxy(tokeninfo.URL, provider.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newHTTPClient()
+
+	t.Log("make a request to the proxy without a cookie and follow the redirects up to the provider")
+	rsp, err := client.Get(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	checkRedirect(t, rsp, provider.URL+"/auth")
+
+	rsp, err = client.Get(rsp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Failed to make request to provider: %v.", err)
+	}
 	defer rsp.Body.Close()
+	checkRedirect(t, rsp, proxy.URL+"/.well-known/oauth2-callback")
 
-	t.Log("get redirected back to the proxy")
-	checkRedirect(t, rsp, proxy.URL)
+	t.Log("follow the callback redirect without presenting the CSRF cookie")
+	req, err := http.NewRequest("GET", rsp.Header.Get("Location"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v.", err)
+	}
 
-	t.Log("check auth cookie was set")
-	checkCookie(t, rsp)
+	rsp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make request to proxy: %v.", err)
+	}
+	defer rsp.Body.Close()
 
-	t.Log("follow the redirect, with the cookie")
+	t.Log("expect the callback to reject the request")
+	checkStatus(t, rsp, http.StatusUnauthorized)
+}
+
+func TestGrantFlowTamperedCSRFCookie(t *testing.T) {
+	t.Log("create a test provider")
+	provider := newTestAuthServer(testToken, testAccessCode)
+	defer provider.Close()
+
+	t.Log("create a test tokeninfo")
+	tokeninfo := newTestTokeninfo(testToken)
+	defer tokeninfo.Close()
+
+	proxy, err := newAuthProxy(tokeninfo.URL, provider.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newHTTPClient()
+
+	rsp, err := client.Get(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	checkRedirect(t, rsp, provider.URL+"/auth")
+
+	rsp, err = client.Get(rsp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Failed to make request to provider: %v.", err)
+	}
+	defer rsp.Body.Close()
+	checkRedirect(t, rsp, proxy.URL+"/.well-known/oauth2-callback")
+
+	t.Log("follow the callback redirect with a tampered CSRF cookie value")
 	req, err := http.NewRequest("GET", rsp.Header.Get("Location"), nil)
 	if err != nil {
 		t.Fatalf("Failed to create request: %v.", err)
 	}
 
-	c, _ := findAuthCookie(rsp)
-	req.Header.Set("Cookie", fmt.Sprintf("%s=%s", c.Name, c.Value))
+	req.Header.Set("Cookie", fmt.Sprintf("%s=%s", auth.OAuthGrantCookieName+"_csrf", "not-the-right-nonce"))
+
 	rsp, err = client.Do(req)
 	if err != nil {
 		t.Fatalf("Failed to make request to proxy: %v.", err)
 	}
+	defer rsp.Body.Close()
 
-	t.Log("check for successful request")
-	checkStatus(t, rsp, http.StatusNoContent)
+	t.Log("expect the callback to reject the request")
+	checkStatus(t, rsp, http.StatusUnauthorized)
+}
+
+func newRefreshTestAuthServer(testToken, testAccessCode string) *httptest.Server {
+	const initialRefreshToken = "initial-refresh-token"
+	const rotatedRefreshToken = "rotated-refresh-token"
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := func(w http.ResponseWriter, r *http.Request) {
+			rq := r.URL.Query()
+			redirect := rq.Get("redirect_uri")
+			rd, err := url.Parse(redirect)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			q := rd.Query()
+			q.Set("code", testAccessCode)
+			q.Set("state", r.URL.Query().Get("state"))
+			rd.RawQuery = q.Encode()
+
+			http.Redirect(w, r, rd.String(), http.StatusTemporaryRedirect)
+		}
+
+		type tokenJSON struct {
+			AccessToken  string `json:"access_token"`
+			RefreshToken string `json:"refresh_token"`
+			ExpiresIn    int    `json:"expires_in"`
+		}
+
+		writeToken := func(w http.ResponseWriter, tok tokenJSON) {
+			b, err := json.Marshal(tok)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(b)
+		}
+
+		token := func(w http.ResponseWriter, r *http.Request) {
+			switch r.FormValue("grant_type") {
+			case "authorization_code":
+				if r.FormValue("code") != testAccessCode {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				writeToken(w, tokenJSON{
+					AccessToken:  testToken,
+					RefreshToken: initialRefreshToken,
+					ExpiresIn:    int(time.Hour / time.Second),
+				})
+			case "refresh_token":
+				if r.FormValue("refresh_token") != initialRefreshToken {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				writeToken(w, tokenJSON{
+					AccessToken:  "refreshed-" + testToken,
+					RefreshToken: rotatedRefreshToken,
+					ExpiresIn:    int(time.Hour / time.Second),
+				})
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}
+
+		switch r.URL.Path {
+		case "/auth":
+			auth(w, r)
+		case "/token":
+			token(w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func newRefreshAuthProxy(tokeninfoURL, providerURL string) (*proxytest.TestProxy, error) {
+	config := &auth.OAuthConfig{
+		Secrets:      secrets.NewRegistry(),
+		SecretFile:   testSecretFile,
+		TokeninfoURL: tokeninfoURL,
+		AuthURL:      providerURL + "/auth",
+		TokenURL:     providerURL + "/token",
+
+		// Larger than the token's lifetime, so the very next
+		// authenticated request always triggers a refresh instead of
+		// waiting for the token to actually approach expiry.
+		TokenRefreshSkew: 2 * time.Hour,
+	}
+
+	return newGrantProxy(config, shuntRoute())
 }
 
 func TestGrantRefresh(t *testing.T) {
-}
\ No newline at end of file
+	t.Log("create a test provider with a working refresh_token grant")
+	provider := newRefreshTestAuthServer(testToken, testAccessCode)
+	defer provider.Close()
+
+	t.Log("create a test tokeninfo")
+	tokeninfo := newTestTokeninfo(testToken)
+	defer tokeninfo.Close()
+
+	proxy, err := newRefreshAuthProxy(tokeninfo.URL, provider.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newHTTPClient()
+
+	t.Log("run through the grant flow to obtain an initial session cookie")
+	rsp := completeGrantFlow(t, client, proxy.URL, provider.URL)
+	defer rsp.Body.Close()
+
+	initialCookie, _ := findAuthCookie(rsp)
+
+	t.Log("use the initial session cookie, expecting a transparent refresh")
+	req, err := http.NewRequest("GET", proxy.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v.", err)
+	}
+
+	req.Header.Set("Cookie", fmt.Sprintf("%s=%s", initialCookie.Name, initialCookie.Value))
+	rsp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make request to proxy: %v.", err)
+	}
+	defer rsp.Body.Close()
+
+	checkStatus(t, rsp, http.StatusNoContent)
+
+	t.Log("expect a new session cookie carrying the refreshed token")
+	refreshedCookie, ok := findAuthCookie(rsp)
+	if !ok {
+		t.Fatalf("Expected a refreshed session cookie to be set.")
+	}
+
+	if refreshedCookie.Value == initialCookie.Value {
+		t.Fatalf("Session cookie was not refreshed.")
+	}
+}
@@ -0,0 +1,139 @@
+package auth_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/auth"
+	"github.com/zalando/skipper/proxy/proxytest"
+	"github.com/zalando/skipper/secrets"
+)
+
+func newEchoWebsocketServer() *httptest.Server {
+	return httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		io.Copy(ws, ws)
+	}))
+}
+
+func newWebsocketAuthProxy(tokeninfoURL, providerURL, backendURL string) (*proxytest.TestProxy, error) {
+	config := &auth.OAuthConfig{
+		Secrets:      secrets.NewRegistry(),
+		SecretFile:   testSecretFile,
+		TokeninfoURL: tokeninfoURL,
+		AuthURL:      providerURL + "/auth",
+		TokenURL:     providerURL + "/token",
+	}
+
+	return newGrantProxy(config, &eskip.Route{
+		Filters: []*eskip.Filter{
+			{Name: auth.OAuthGrantName},
+		},
+		Backend: backendURL,
+	})
+}
+
+func TestGrantWebsocketUnauthenticatedUpgradeRejected(t *testing.T) {
+	t.Log("create a test provider, tokeninfo and websocket backend")
+	provider := newTestAuthServer(testToken, testAccessCode)
+	defer provider.Close()
+
+	tokeninfo := newTestTokeninfo(testToken)
+	defer tokeninfo.Close()
+
+	backend := newEchoWebsocketServer()
+	defer backend.Close()
+
+	proxy, err := newWebsocketAuthProxy(tokeninfo.URL, provider.URL, backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", proxy.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v.", err)
+	}
+
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+
+	client := newHTTPClient()
+	rsp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make request to proxy: %v.", err)
+	}
+	defer rsp.Body.Close()
+
+	t.Log("expect a 401, not a redirect a websocket handshake can't follow")
+	checkStatus(t, rsp, http.StatusUnauthorized)
+
+	if rsp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("Expected a WWW-Authenticate hint on the rejected upgrade.")
+	}
+}
+
+func TestGrantWebsocketAuthenticatedUpgradePassesThrough(t *testing.T) {
+	t.Log("create a test provider, tokeninfo and websocket echo backend")
+	provider := newTestAuthServer(testToken, testAccessCode)
+	defer provider.Close()
+
+	tokeninfo := newTestTokeninfo(testToken)
+	defer tokeninfo.Close()
+
+	backend := newEchoWebsocketServer()
+	defer backend.Close()
+
+	proxy, err := newWebsocketAuthProxy(tokeninfo.URL, provider.URL, backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("run through the grant flow to obtain a session cookie")
+	client := newHTTPClient()
+
+	rsp := completeGrantFlow(t, client, proxy.URL, provider.URL)
+	defer rsp.Body.Close()
+
+	c, ok := findAuthCookie(rsp)
+	if !ok {
+		t.Fatalf("Cookie not found.")
+	}
+
+	t.Log("dial a websocket upgrade presenting the session cookie")
+	wsURL := "ws" + strings.TrimPrefix(proxy.URL, "http")
+
+	wsConfig, err := websocket.NewConfig(wsURL, proxy.URL)
+	if err != nil {
+		t.Fatalf("Failed to create websocket config: %v.", err)
+	}
+	wsConfig.Header.Set("Cookie", fmt.Sprintf("%s=%s", c.Name, c.Value))
+
+	ws, err := websocket.DialConfig(wsConfig)
+	if err != nil {
+		t.Fatalf("Failed to dial websocket: %v.", err)
+	}
+	defer ws.Close()
+
+	msg := []byte("ping")
+	if _, err := ws.Write(msg); err != nil {
+		t.Fatalf("Failed to write to websocket: %v.", err)
+	}
+
+	reply := make([]byte, len(msg))
+	if _, err := io.ReadFull(ws, reply); err != nil {
+		t.Fatalf("Failed to read from websocket: %v.", err)
+	}
+
+	t.Log("expect the authenticated upgrade to have reached the echo backend")
+	if string(reply) != string(msg) {
+		t.Fatalf("Unexpected echo reply, got: %q, expected: %q.", reply, msg)
+	}
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+)
+
+type grantCallbackSpec struct {
+	config *OAuthConfig
+}
+
+func (s *grantCallbackSpec) Name() string { return OAuthGrantCallbackName }
+
+func (s *grantCallbackSpec) CreateFilter([]interface{}) (filters.Filter, error) {
+	return &grantCallbackFilter{config: s.config}, nil
+}
+
+type grantCallbackFilter struct {
+	config *OAuthConfig
+}
+
+func (f *grantCallbackFilter) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	q := req.URL.Query()
+
+	state, err := parseState(q.Get("state"))
+	if err != nil {
+		ctx.Serve(&http.Response{StatusCode: http.StatusBadRequest})
+		return
+	}
+
+	if err := validateCSRF(req, state); err != nil {
+		ctx.Serve(&http.Response{StatusCode: http.StatusUnauthorized})
+		return
+	}
+
+	if err := validateRedirectTarget(f.config, req, state.RedirectURL); err != nil {
+		ctx.Serve(&http.Response{StatusCode: http.StatusBadRequest})
+		return
+	}
+
+	tok, err := exchangeCode(f.config, req, q.Get("code"), state.Nonce)
+	if err != nil {
+		ctx.Serve(&http.Response{StatusCode: http.StatusUnauthorized})
+		return
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		ctx.Serve(&http.Response{StatusCode: http.StatusInternalServerError})
+		return
+	}
+
+	sessionCookies, err := f.config.Store.Save(ctx, id, tok)
+	if err != nil {
+		ctx.Serve(&http.Response{StatusCode: http.StatusInternalServerError})
+		return
+	}
+
+	rsp := &http.Response{
+		Header:     http.Header{},
+		StatusCode: http.StatusTemporaryRedirect,
+	}
+
+	rsp.Header.Set("Location", state.RedirectURL)
+	for _, c := range sessionCookies {
+		http.SetCookie(&headerWriter{rsp.Header}, c)
+	}
+	http.SetCookie(&headerWriter{rsp.Header}, expiredCSRFCookie())
+
+	ctx.Serve(rsp)
+}
+
+func (f *grantCallbackFilter) Response(filters.FilterContext) {}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	IDToken      string `json:"id_token"`
+}
+
+func exchangeCode(config *OAuthConfig, req *http.Request, code, nonce string) (*sessionToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", callbackURL(config, req))
+	form.Set("client_id", config.ClientID)
+	form.Set("client_secret", config.ClientSecret)
+
+	t, err := requestToken(config, form)
+	if err != nil {
+		return nil, err
+	}
+
+	tok := &sessionToken{
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(t.ExpiresIn) * time.Second),
+	}
+
+	if config.Issuer != "" && t.IDToken != "" {
+		claims, err := validateIDToken(config, t.IDToken, nonce)
+		if err != nil {
+			return nil, err
+		}
+
+		tok.IDClaims = claims
+	}
+
+	return tok, nil
+}
+
+// refreshAccessToken exchanges refreshToken for a new access token,
+// carrying over the id_token claims if the provider returns a fresh one
+// and otherwise keeping none, since a refresh response is not required to
+// include an id_token.
+func refreshAccessToken(config *OAuthConfig, refreshToken string) (*sessionToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	form.Set("client_id", config.ClientID)
+	form.Set("client_secret", config.ClientSecret)
+
+	t, err := requestToken(config, form)
+	if err != nil {
+		return nil, err
+	}
+
+	tok := &sessionToken{
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(t.ExpiresIn) * time.Second),
+	}
+
+	if tok.RefreshToken == "" {
+		tok.RefreshToken = refreshToken
+	}
+
+	if config.Issuer != "" && t.IDToken != "" {
+		if claims, err := validateIDToken(config, t.IDToken, ""); err == nil {
+			tok.IDClaims = claims
+		}
+	}
+
+	return tok, nil
+}
+
+func requestToken(config *OAuthConfig, form url.Values) (*tokenResponse, error) {
+	rsp, err := http.PostForm(config.TokenURL, form)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, errTokenExchangeFailed
+	}
+
+	var t tokenResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&t); err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routing"
+)
+
+// grantPreprocessor injects a route for the OAuth2 callback path so that
+// users don't have to declare it explicitly alongside every route that
+// uses the grant filter.
+type grantPreprocessor struct {
+	config *OAuthConfig
+}
+
+// NewGrantPreprocessor creates a routing.PreProcessor that adds the
+// callback route required by the grant flow to the routing table.
+func (c *OAuthConfig) NewGrantPreprocessor() (routing.PreProcessor, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+
+	return &grantPreprocessor{config: c}, nil
+}
+
+func (p *grantPreprocessor) Do(routes []*eskip.Route) []*eskip.Route {
+	return append(routes, &eskip.Route{
+		Id:          "oauthGrantCallback",
+		PathExact:   p.config.CallbackPath,
+		BackendType: eskip.ShuntBackend,
+		Filters: []*eskip.Filter{
+			{Name: OAuthGrantCallbackName},
+		},
+	})
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var errDisallowedRedirect = errors.New("auth: redirect target not allowed")
+
+// validateRedirectTarget checks that redirectURL, round-tripped through
+// the OAuth2 state parameter, is safe to send the client to once the
+// callback completes. Without this check, anyone able to obtain a valid
+// CSRF nonce (i.e. anyone who can start the grant flow) could point
+// RedirectURL anywhere, turning the callback into an open redirect.
+func validateRedirectTarget(config *OAuthConfig, req *http.Request, redirectURL string) error {
+	u, err := url.Parse(redirectURL)
+	if err != nil || u.Host == "" {
+		return errDisallowedRedirect
+	}
+
+	if u.Scheme != requestScheme(req) {
+		return errDisallowedRedirect
+	}
+
+	allowed := config.AllowedRedirectDomains
+	if len(allowed) == 0 {
+		allowed = []string{req.Host}
+	}
+
+	for _, domain := range allowed {
+		if redirectDomainMatches(u.Host, domain) {
+			return nil
+		}
+	}
+
+	return errDisallowedRedirect
+}
+
+// redirectDomainMatches reports whether host matches pattern, where
+// pattern is either an exact host (with optional port) or a wildcard
+// subdomain pattern such as "*.example.com". The wildcard never matches
+// the bare apex domain itself.
+func redirectDomainMatches(host, pattern string) bool {
+	if strings.HasPrefix(pattern, "*.") {
+		suffix := pattern[1:]
+		return strings.HasSuffix(host, suffix) && host != suffix[1:]
+	}
+
+	return host == pattern
+}
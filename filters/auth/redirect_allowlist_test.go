@@ -0,0 +1,157 @@
+package auth_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/zalando/skipper/filters/auth"
+	"github.com/zalando/skipper/proxy/proxytest"
+	"github.com/zalando/skipper/secrets"
+)
+
+func hostOf(t *testing.T, rawURL string) string {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL %q: %v.", rawURL, err)
+	}
+
+	return u.Host
+}
+
+func newAuthProxyWithAllowedRedirectDomains(tokeninfoURL, providerURL string, domains []string) (*proxytest.TestProxy, error) {
+	config := &auth.OAuthConfig{
+		Secrets:                secrets.NewRegistry(),
+		SecretFile:             testSecretFile,
+		TokeninfoURL:           tokeninfoURL,
+		AuthURL:                providerURL + "/auth",
+		TokenURL:               providerURL + "/token",
+		AllowedRedirectDomains: domains,
+	}
+
+	return newGrantProxy(config, shuntRoute())
+}
+
+// encodeGrantState replicates the wire format of the grant flow's state
+// parameter, so tests can forge one carrying an arbitrary redirect target
+// without depending on unexported internals.
+func encodeGrantState(nonce, redirectURL string) string {
+	b, _ := json.Marshal(struct {
+		Nonce       string `json:"nonce"`
+		RedirectURL string `json:"redirect_url"`
+	}{Nonce: nonce, RedirectURL: redirectURL})
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func doCallbackRequest(t *testing.T, proxyURL, redirectURL string, extraHeaders map[string]string) *http.Response {
+	t.Helper()
+
+	const nonce = "test-nonce"
+	state := encodeGrantState(nonce, redirectURL)
+
+	req, err := http.NewRequest(
+		"GET",
+		fmt.Sprintf("%s/.well-known/oauth2-callback?code=%s&state=%s", proxyURL, testAccessCode, state),
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create callback request: %v.", err)
+	}
+
+	req.Header.Set("Cookie", fmt.Sprintf("%s=%s", auth.OAuthGrantCookieName+"_csrf", nonce))
+	for k, v := range extraHeaders {
+		req.Header.Set(k, v)
+	}
+
+	client := newHTTPClient()
+	rsp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make callback request: %v.", err)
+	}
+
+	return rsp
+}
+
+func TestGrantCallbackRedirectAllowlistExactMatch(t *testing.T) {
+	provider := newTestAuthServer(testToken, testAccessCode)
+	defer provider.Close()
+
+	tokeninfo := newTestTokeninfo(testToken)
+	defer tokeninfo.Close()
+
+	proxy, err := newAuthProxy(tokeninfo.URL, provider.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("redirecting back to the proxy's own host is allowed by default")
+	rsp := doCallbackRequest(t, proxy.URL, proxy.URL+"/after-login", nil)
+	defer rsp.Body.Close()
+
+	checkRedirect(t, rsp, proxy.URL+"/after-login")
+}
+
+func TestGrantCallbackRedirectAllowlistSubdomainWildcard(t *testing.T) {
+	provider := newTestAuthServer(testToken, testAccessCode)
+	defer provider.Close()
+
+	tokeninfo := newTestTokeninfo(testToken)
+	defer tokeninfo.Close()
+
+	proxy, err := newAuthProxyWithAllowedRedirectDomains(tokeninfo.URL, provider.URL, []string{"*.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("a host matching the wildcard subdomain pattern is allowed")
+	rsp := doCallbackRequest(t, proxy.URL, "http://app.example.com/after-login", nil)
+	defer rsp.Body.Close()
+
+	checkRedirect(t, rsp, "http://app.example.com/after-login")
+}
+
+func TestGrantCallbackRedirectAllowlistCrossDomainRejected(t *testing.T) {
+	provider := newTestAuthServer(testToken, testAccessCode)
+	defer provider.Close()
+
+	tokeninfo := newTestTokeninfo(testToken)
+	defer tokeninfo.Close()
+
+	proxy, err := newAuthProxy(tokeninfo.URL, provider.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("a redirect target on a different domain must be rejected")
+	rsp := doCallbackRequest(t, proxy.URL, "http://evil.example.org/phish", nil)
+	defer rsp.Body.Close()
+
+	checkStatus(t, rsp, http.StatusBadRequest)
+}
+
+func TestGrantCallbackRedirectAllowlistSchemeDowngradeRejected(t *testing.T) {
+	provider := newTestAuthServer(testToken, testAccessCode)
+	defer provider.Close()
+
+	tokeninfo := newTestTokeninfo(testToken)
+	defer tokeninfo.Close()
+
+	proxy, err := newAuthProxy(tokeninfo.URL, provider.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("the request arrived over https (per X-Forwarded-Proto), a plain http redirect target must be rejected")
+	rsp := doCallbackRequest(t, proxy.URL, "http://"+hostOf(t, proxy.URL)+"/after-login", map[string]string{
+		"X-Forwarded-Proto": "https",
+	})
+	defer rsp.Body.Close()
+
+	checkStatus(t, rsp, http.StatusBadRequest)
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// RedisClient is the minimal subset of a Redis client that
+// RedisSessionStore needs, so this package doesn't have to depend on a
+// particular Redis library.
+type RedisClient interface {
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Del(ctx context.Context, key string) error
+}
+
+// RedisSessionStore is a SessionStore that keeps only an opaque session
+// id in the browser cookie, while the access/refresh token and its
+// expiry live server-side in Redis, keyed by that id. Unlike
+// CookieSessionStore it isn't bound by the browser's per-cookie size
+// limit, and it allows revoking a session server-side without waiting
+// for the cookie to expire.
+type RedisSessionStore struct {
+	client    RedisClient
+	keyPrefix string
+	ttl       time.Duration
+}
+
+// NewRedisSessionStore creates a RedisSessionStore that stores sessions
+// under keyPrefix+id and expires them after ttl.
+func NewRedisSessionStore(client RedisClient, keyPrefix string, ttl time.Duration) *RedisSessionStore {
+	return &RedisSessionStore{client: client, keyPrefix: keyPrefix, ttl: ttl}
+}
+
+func (s *RedisSessionStore) Save(ctx filters.FilterContext, id string, tok *sessionToken) ([]*http.Cookie, error) {
+	b, err := json.Marshal(tok)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.client.Set(ctx.Request().Context(), s.key(id), b, s.ttl); err != nil {
+		return nil, err
+	}
+
+	return []*http.Cookie{{
+		Name:     OAuthGrantCookieChunkName(0),
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(s.ttl / time.Second),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}}, nil
+}
+
+func (s *RedisSessionStore) Load(_ filters.FilterContext, req *http.Request) (*sessionToken, error) {
+	c, err := req.Cookie(OAuthGrantCookieChunkName(0))
+	if err != nil || c.Value == "" {
+		return nil, errMissingSessionCookie
+	}
+
+	b, err := s.client.Get(req.Context(), s.key(c.Value))
+	if err != nil {
+		return nil, errMissingSessionCookie
+	}
+
+	var tok sessionToken
+	if err := json.Unmarshal(b, &tok); err != nil {
+		return nil, errMissingSessionCookie
+	}
+
+	if time.Now().After(tok.Expiry) {
+		return nil, errMissingSessionCookie
+	}
+
+	return &tok, nil
+}
+
+func (s *RedisSessionStore) Clear(_ filters.FilterContext, req *http.Request) ([]*http.Cookie, error) {
+	if c, err := req.Cookie(OAuthGrantCookieChunkName(0)); err == nil && c.Value != "" {
+		// Best-effort: a failure to delete here just means the
+		// session outlives the cookie until its TTL expires.
+		_ = s.client.Del(req.Context(), s.key(c.Value))
+	}
+
+	return []*http.Cookie{expiredSessionCookie(OAuthGrantCookieChunkName(0))}, nil
+}
+
+func (s *RedisSessionStore) key(id string) string {
+	return s.keyPrefix + id
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/zalando/skipper/filters"
+)
+
+var errMissingSessionCookie = errors.New("auth: missing session cookie")
+
+// SessionStore abstracts where the grant session - the access/refresh
+// token obtained from the OAuth2 provider - is kept between requests.
+// The grant and grant callback filters only talk to this interface, so
+// the actual storage can range from sealing everything into the browser
+// cookie to keeping just an opaque session id there and the token itself
+// server-side.
+type SessionStore interface {
+	// Save persists tok under id, returning the cookie(s) that the
+	// callback filter should set on the response. Implementations that
+	// seal the session into the cookie itself may need more than one,
+	// since a single cookie is limited to about 4KB in the browser.
+	Save(ctx filters.FilterContext, id string, tok *sessionToken) ([]*http.Cookie, error)
+
+	// Load resolves the session referenced by req's cookie(s) and
+	// returns the token that was previously saved for it.
+	Load(ctx filters.FilterContext, req *http.Request) (*sessionToken, error)
+
+	// Clear removes the session referenced by req's cookie(s) and
+	// returns the cookie(s) that delete it on the client.
+	Clear(ctx filters.FilterContext, req *http.Request) ([]*http.Cookie, error)
+}
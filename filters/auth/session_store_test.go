@@ -0,0 +1,113 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters/auth"
+	"github.com/zalando/skipper/proxy/proxytest"
+	"github.com/zalando/skipper/secrets"
+)
+
+// fakeRedisClient is an in-memory stand-in for auth.RedisClient, good
+// enough to exercise RedisSessionStore without a real Redis instance.
+type fakeRedisClient struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newFakeRedisClient() *fakeRedisClient {
+	return &fakeRedisClient{data: make(map[string][]byte)}
+}
+
+func (c *fakeRedisClient) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+	return nil
+}
+
+func (c *fakeRedisClient) Get(_ context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.data[key]
+	if !ok {
+		return nil, errFakeRedisMiss
+	}
+	return v, nil
+}
+
+func (c *fakeRedisClient) Del(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.data, key)
+	return nil
+}
+
+var errFakeRedisMiss = &fakeRedisMissError{}
+
+type fakeRedisMissError struct{}
+
+func (*fakeRedisMissError) Error() string { return "fakeredis: no such key" }
+
+func newAuthProxyWithStore(tokeninfoURL, providerURL string, store auth.SessionStore) (*proxytest.TestProxy, error) {
+	config := &auth.OAuthConfig{
+		Secrets:      secrets.NewRegistry(),
+		SecretFile:   testSecretFile,
+		TokeninfoURL: tokeninfoURL,
+		AuthURL:      providerURL + "/auth",
+		TokenURL:     providerURL + "/token",
+		Store:        store,
+	}
+
+	return newGrantProxy(config, shuntRoute())
+}
+
+// TestSessionStoreConformance runs a TestGrantFlow-style round trip
+// against every registered SessionStore backend, to make sure they are
+// interchangeable from the grant filters' point of view.
+func TestSessionStoreConformance(t *testing.T) {
+	backends := map[string]auth.SessionStore{
+		"cookie": nil, // nil Store makes OAuthConfig default to CookieSessionStore
+		"redis":  auth.NewRedisSessionStore(newFakeRedisClient(), "grant-session:", time.Hour),
+	}
+
+	for name, store := range backends {
+		name, store := name, store
+		t.Run(name, func(t *testing.T) {
+			provider := newTestAuthServer(testToken, testAccessCode)
+			defer provider.Close()
+
+			tokeninfo := newTestTokeninfo(testToken)
+			defer tokeninfo.Close()
+
+			proxy, err := newAuthProxyWithStore(tokeninfo.URL, provider.URL, store)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := newHTTPClient()
+
+			rsp := completeGrantFlow(t, client, proxy.URL, provider.URL)
+			defer rsp.Body.Close()
+
+			req, err := http.NewRequest("GET", rsp.Header.Get("Location"), nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v.", err)
+			}
+
+			c, _ := findAuthCookie(rsp)
+			req.Header.Set("Cookie", c.Name+"="+c.Value)
+			rsp, err = client.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to make request to proxy: %v.", err)
+			}
+			defer rsp.Body.Close()
+
+			checkStatus(t, rsp, http.StatusNoContent)
+		})
+	}
+}